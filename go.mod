@@ -0,0 +1,3 @@
+module github.com/arpitrohela/SecretScanner
+
+go 1.19
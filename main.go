@@ -3,14 +3,21 @@ package main
 import (
 	"bufio"
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/fs"
 	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -28,11 +35,192 @@ var (
 	contextRe   = regexp.MustCompile(`(?i)(password|token|key|secret|auth|credential)`)
 	b64Re       = regexp.MustCompile(`[A-Za-z0-9+/]{20,}={0,2}`)
 	hexRe       = regexp.MustCompile(`[0-9a-fA-F]{32,}`)
-	excludeRe   = regexp.MustCompile(`(?i)(example|test|dummy|fake|sample|placeholder)`)
-	whitelist   = map[string]bool{}
-	found       = map[string]bool{}
+	excludeList = []string{"example", "test", "dummy", "fake", "sample", "placeholder"}
+	excludeRe   = compileExclude(excludeList)
+	textExts    = map[string]bool{
+		".txt": true, ".log": true, ".json": true, ".xml": true,
+		".yaml": true, ".yml": true, ".conf": true, ".cfg": true,
+		".go": true, ".rs": true, ".py": true, ".js": true,
+		".java": true, ".c": true, ".cpp": true, ".sh": true,
+		".sql": true, ".md": true, ".html": true, ".css": true,
+	}
+	thresholds  = map[string]threshold{}
+	whitelist   = newHashSet()
+	validations = &validationCache{m: map[string]*validation{}}
+	httpClient  = &http.Client{Timeout: 2 * time.Second}
+)
+
+const (
+	defaultMinEntropy = 4.5
+	defaultMinScore   = 8.5
+	liveValidators    = 4 // concurrent network checks, see checkLive
 )
 
+// threshold holds per-pattern overrides of the entropy boost and score cutoff.
+type threshold struct {
+	minEntropy float64
+	minScore   float64
+}
+
+// Config is the on-disk format accepted by --config.
+type Config struct {
+	Patterns   map[string]PatternConfig `json:"patterns"`
+	Extensions []string                 `json:"extensions"`
+	Exclude    []string                 `json:"exclude"`
+}
+
+// PatternConfig adds a named pattern or overrides a built-in one.
+type PatternConfig struct {
+	Regex      string   `json:"regex"`
+	MinEntropy *float64 `json:"minEntropy"`
+	MinScore   *float64 `json:"minScore"`
+	Disabled   bool     `json:"disabled"`
+}
+
+func compileExclude(words []string) *regexp.Regexp {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = regexp.QuoteMeta(w)
+	}
+	return regexp.MustCompile(`(?i)(` + strings.Join(quoted, "|") + `)`)
+}
+
+func thresholdFor(stype string) threshold {
+	if t, ok := thresholds[stype]; ok {
+		return t
+	}
+	return threshold{defaultMinEntropy, defaultMinScore}
+}
+
+func loadConfig(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var cfg Config
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	for name, pc := range cfg.Patterns {
+		if pc.Disabled {
+			delete(patterns, name)
+			continue
+		}
+		if pc.Regex != "" {
+			re, err := regexp.Compile(pc.Regex)
+			if err != nil {
+				return fmt.Errorf("%s: pattern %q: %v", path, name, err)
+			}
+			patterns[name] = re
+		} else if patterns[name] == nil {
+			return fmt.Errorf("%s: pattern %q has no regex and is not built in", path, name)
+		}
+		t := threshold{defaultMinEntropy, defaultMinScore}
+		if pc.MinEntropy != nil {
+			t.minEntropy = *pc.MinEntropy
+		}
+		if pc.MinScore != nil {
+			t.minScore = *pc.MinScore
+		}
+		thresholds[name] = t
+	}
+
+	for _, ext := range cfg.Extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if strings.TrimPrefix(ext, ".") == "" {
+			return fmt.Errorf("%s: empty extension", path)
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		textExts[ext] = true
+	}
+
+	// An empty word would make excludeRe match, and so drop, every secret
+	for _, w := range cfg.Exclude {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			return fmt.Errorf("%s: empty exclude word", path)
+		}
+		excludeList = append(excludeList, w)
+	}
+	if len(cfg.Exclude) > 0 {
+		excludeRe = compileExclude(excludeList)
+	}
+	return nil
+}
+
+// hashSet is a set of secret hashes safe for use from multiple workers.
+type hashSet struct {
+	mu sync.Mutex
+	m  map[string]bool
+}
+
+func newHashSet() *hashSet {
+	return &hashSet{m: map[string]bool{}}
+}
+
+func (h *hashSet) has(hash string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.m[hash]
+}
+
+// add records hash and reports whether it was not already present.
+func (h *hashSet) add(hash string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.m[hash] {
+		return false
+	}
+	h.m[hash] = true
+	return true
+}
+
+// Finding is a single validated secret reported by the scanner.
+type Finding struct {
+	Type    string  `json:"type"`
+	File    string  `json:"file"`
+	Line    int     `json:"line"`
+	Column  int     `json:"column"`
+	Hash    string  `json:"hash"`
+	Entropy float64 `json:"entropy"`
+	Score   float64 `json:"score"`
+	Secret  string  `json:"secret,omitempty"`
+
+	seq int // walk order of File, used to dedup like a serial scan
+}
+
+// validation memoises validate for one secret so concurrent workers
+// seeing the same token only check it once.
+type validation struct {
+	once sync.Once
+	ok   bool
+}
+
+type validationCache struct {
+	mu sync.Mutex
+	m  map[string]*validation
+}
+
+func (c *validationCache) validate(secret, stype string) bool {
+	key := stype + "\x00" + secret
+	c.mu.Lock()
+	v := c.m[key]
+	if v == nil {
+		v = &validation{}
+		c.m[key] = v
+	}
+	c.mu.Unlock()
+	v.once.Do(func() { v.ok = validate(secret, stype) })
+	return v.ok
+}
+
 func entropy(s string) float64 {
 	m := make(map[rune]float64)
 	for _, r := range s {
@@ -68,11 +256,14 @@ func validate(secret, stype string) bool {
 	case "AWS":
 		return len(secret) == 20 && strings.HasPrefix(secret, "AKIA")
 	case "GitHub":
-		client := &http.Client{Timeout: 2 * time.Second}
 		req, _ := http.NewRequest("GET", "https://api.github.com/user", nil)
 		req.Header.Set("Authorization", "token "+secret)
-		resp, err := client.Do(req)
-		return err == nil && resp.StatusCode != 401
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode != 401
 	case "CC":
 		return luhn(secret)
 	}
@@ -125,7 +316,14 @@ func entropyFilter(content string) []string {
 	return suspects
 }
 
-func scan(content, file string) {
+// isLive reports whether validating stype needs a network call. Such
+// findings are returned by scan unchecked and validated by checkLive.
+func isLive(stype string) bool {
+	return stype == "GitHub"
+}
+
+func scan(content, file string) []Finding {
+	var out []Finding
 	lines := strings.Split(content, "\n")
 	
 	// Layer 1: Basic pattern matching
@@ -135,28 +333,30 @@ func scan(content, file string) {
 			secret := content[match[0]:match[1]]
 			hash := fmt.Sprintf("%x", sha256.Sum256([]byte(secret)))[:8]
 			
-			if found[hash] || whitelist[hash] {
+			if whitelist.has(hash) {
 				continue
 			}
 			
 			// Layer 2: Multi-layer validation
-			if secondLayerValidate(secret, name, content, match, lines, file) {
-				found[hash] = true
+			if f, ok := secondLayerValidate(secret, name, content, match, lines, file); ok {
+				f.Hash = hash
+				out = append(out, f)
 			}
 		}
 	}
+	return out
 }
 
-func secondLayerValidate(secret, stype, content string, match []int, lines []string, file string) bool {
+func secondLayerValidate(secret, stype, content string, match []int, lines []string, file string) (Finding, bool) {
 	// Pre-filtering
 	filteredContent := preFilter(content)
 	if !strings.Contains(filteredContent, secret) {
-		return false
+		return Finding{}, false
 	}
 	
 	// Exclude obvious test data
 	if excludeRe.MatchString(secret) {
-		return false
+		return Finding{}, false
 	}
 	
 	// Find line and context
@@ -176,61 +376,412 @@ func secondLayerValidate(secret, stype, content string, match []int, lines []str
 	score := contextScore(currentLine, match[0]-charCount)
 	
 	// Entropy analysis
-	if entropy(secret) >= 4.5 {
+	t := thresholdFor(stype)
+	e := entropy(secret)
+	if e >= t.minEntropy {
 		score += 2.0
 	}
 	
 	// Context score threshold
-	if score < 8.5 {
-		return false
+	if score < t.minScore {
+		return Finding{}, false
 	}
 	
 	// Validation layer
-	if !validate(secret, stype) {
-		return false
+	if !isLive(stype) && !validations.validate(secret, stype) {
+		return Finding{}, false
 	}
 	
-	fmt.Printf("%s: %s in %s:%d (score:%.1f)\n", stype, secret, file, lineNum, score)
-	return true
+	return Finding{
+		Type:    stype,
+		File:    file,
+		Line:    lineNum,
+		Column:  match[0] - charCount + 1,
+		Entropy: e,
+		Score:   score,
+		Secret:  secret,
+	}, true
+}
+
+// checkLive runs the network validation of live findings on a small pool
+// of its own, so scanning workers never wait on it, and drops the failures.
+func checkLive(all []Finding) []Finding {
+	ok := make([]bool, len(all))
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < liveValidators; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				ok[i] = validations.validate(all[i].Secret, all[i].Type)
+			}
+		}()
+	}
+	for i, f := range all {
+		if isLive(f.Type) {
+			idx <- i
+		} else {
+			ok[i] = true
+		}
+	}
+	close(idx)
+	wg.Wait()
+
+	var out []Finding
+	for i, f := range all {
+		if ok[i] {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// dedupe orders findings as a serial walk would report them and keeps only
+// the first occurrence of each secret.
+func dedupe(all []Finding) []Finding {
+	sort.Slice(all, func(i, j int) bool {
+		a, b := all[i], all[j]
+		if a.seq != b.seq {
+			return a.seq < b.seq
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.Type < b.Type
+	})
+	seen := map[string]bool{}
+	var out []Finding
+	for _, f := range all {
+		if !seen[f.Hash] {
+			seen[f.Hash] = true
+			out = append(out, f)
+		}
+	}
+	return out
 }
 
 func isText(path string, forceAll bool) bool {
 	if forceAll {
 		return true
 	}
-	ext := strings.ToLower(filepath.Ext(path))
-	return ext == ".txt" || ext == ".log" || ext == ".json" || ext == ".xml" || 
-		ext == ".yaml" || ext == ".yml" || ext == ".conf" || ext == ".cfg" || 
-		ext == ".go" || ext == ".rs" || ext == ".py" || ext == ".js" || 
-		ext == ".java" || ext == ".c" || ext == ".cpp" || ext == ".sh" || 
-		ext == ".sql" || ext == ".md" || ext == ".html" || ext == ".css"
+	return textExts[strings.ToLower(filepath.Ext(path))]
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactLocation `json:"originalUriBaseIds"`
+	Results            []sarifResult                    `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+}
+
+func writeText(w io.Writer, out []Finding) {
+	for _, f := range out {
+		fmt.Fprintf(w, "%s: %s in %s:%d (score:%.1f)\n", f.Type, f.Secret, f.File, f.Line, f.Score)
+	}
+}
+
+func writeJSON(w io.Writer, out []Finding) error {
+	if out == nil {
+		out = []Finding{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// sarifBase returns the file URI of the scan root, which results are
+// reported relative to so code scanning can map them onto repo files.
+func sarifBase(root string) (string, string, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return "", "", err
+	}
+	if info, err := os.Stat(abs); err == nil && !info.IsDir() {
+		abs = filepath.Dir(abs)
+	}
+	p := filepath.ToSlash(abs)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	if !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	return abs, (&url.URL{Scheme: "file", Path: p}).String(), nil
+}
+
+func writeSARIF(w io.Writer, out []Finding, root string) error {
+	base, baseURI, err := sarifBase(root)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rules := make([]sarifRule, len(names))
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		rules[i] = sarifRule{
+			ID:               name,
+			Name:             name + "Secret",
+			ShortDescription: sarifMessage{name + " secret detected"},
+		}
+		index[name] = i
+	}
+
+	results := []sarifResult{}
+	for _, f := range out {
+		msg := fmt.Sprintf("%s secret (hash %s, score %.1f)", f.Type, f.Hash, f.Score)
+		if f.Secret != "" {
+			msg = fmt.Sprintf("%s secret %s (hash %s, score %.1f)", f.Type, f.Secret, f.Hash, f.Score)
+		}
+		path, err := filepath.Abs(f.File)
+		if err == nil {
+			path, err = filepath.Rel(base, path)
+		}
+		if err != nil {
+			return err
+		}
+		results = append(results, sarifResult{
+			RuleID:    f.Type,
+			RuleIndex: index[f.Type],
+			Level:     "error",
+			Message:   sarifMessage{msg},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{filepath.ToSlash(path), "%SRCROOT%"},
+					Region:           sarifRegion{f.Line, f.Column},
+				},
+			}},
+			PartialFingerprints: map[string]string{"secretHash/v1": f.Hash},
+		})
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{sarifDriver{
+				Name:           "SecretScanner",
+				InformationURI: "https://github.com/arpitrohela/SecretScanner",
+				Rules:          rules,
+			}},
+			OriginalURIBaseIDs: map[string]sarifArtifactLocation{
+				"%SRCROOT%": {URI: baseURI},
+			},
+			Results: results,
+		}},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+func writeFindings(w io.Writer, out []Finding, format, root string, showSecrets bool) error {
+	// Redact live credentials from machine-readable output unless asked
+	if format != "text" && !showSecrets {
+		redacted := make([]Finding, len(out))
+		for i, f := range out {
+			f.Secret = ""
+			redacted[i] = f
+		}
+		out = redacted
+	}
+
+	switch format {
+	case "json":
+		return writeJSON(w, out)
+	case "sarif":
+		return writeSARIF(w, out, root)
+	}
+	writeText(w, out)
+	return nil
+}
+
+func usage(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", a...)
+	os.Exit(2)
+}
+
+// flagValue returns the value of flag name at args[*i], given either as
+// "name value" or "name=value", advancing *i past a separate value.
+func flagValue(args []string, i *int, name string) (string, bool) {
+	arg := args[*i]
+	if strings.HasPrefix(arg, name+"=") {
+		if v := strings.TrimPrefix(arg, name+"="); v != "" {
+			return v, true
+		}
+		usage("%s requires a value", name)
+	}
+	if arg != name {
+		return "", false
+	}
+	if *i+1 >= len(args) || strings.HasPrefix(args[*i+1], "--") {
+		usage("%s requires a value", name)
+	}
+	*i++
+	return args[*i], true
 }
 
 func main() {
 	root := "."
 	forceAll := false
+	format := "text"
+	showSecrets := false
+	workers := runtime.NumCPU()
+	configPath := ""
 	
 	args := os.Args[1:]
-	for _, arg := range args {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
 		if arg == "--all" {
 			forceAll = true
 		} else if arg == "--whitelist" {
 			fmt.Print("Enter hash to whitelist: ")
 			var hash string
 			fmt.Scanln(&hash)
-			whitelist[hash] = true
+			whitelist.add(hash)
+		} else if v, ok := flagValue(args, &i, "--format"); ok {
+			format = v
+		} else if v, ok := flagValue(args, &i, "--workers"); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				usage("invalid worker count %q", v)
+			}
+			workers = n
+		} else if v, ok := flagValue(args, &i, "--config"); ok {
+			configPath = v
+		} else if arg == "--show-secrets" {
+			showSecrets = true
+		} else if strings.HasPrefix(arg, "--") {
+			usage("unknown flag %s", arg)
 		} else {
 			root = arg
 		}
 	}
+	if format != "text" && format != "json" && format != "sarif" {
+		usage("unknown format %q (want text, json or sarif)", format)
+	}
+	if configPath != "" {
+		if err := loadConfig(configPath); err != nil {
+			fmt.Fprintln(os.Stderr, "config:", err)
+			os.Exit(2)
+		}
+	}
+
+	type job struct {
+		seq  int
+		path string
+	}
+	jobs := make(chan job, workers*4)
+	results := make(chan []Finding, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				content, err := os.ReadFile(j.path)
+				if err != nil {
+					continue
+				}
+				out := scan(string(content), j.path)
+				for k := range out {
+					out[k].seq = j.seq
+				}
+				if len(out) > 0 {
+					results <- out
+				}
+			}
+		}()
+	}
 
-	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-		if err != nil || d.IsDir() || !isText(path, forceAll) {
+	go func() {
+		seq := 0
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !isText(path, forceAll) {
+				return nil
+			}
+			jobs <- job{seq, path}
+			seq++
 			return nil
-		}
-		if content, err := os.ReadFile(path); err == nil {
-			scan(string(content), path)
-		}
-		return nil
-	})
+		})
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	var findings []Finding
+	for out := range results {
+		findings = append(findings, out...)
+	}
+	findings = dedupe(checkLive(findings))
+
+	if err := writeFindings(os.Stdout, findings, format, root, showSecrets); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
 }